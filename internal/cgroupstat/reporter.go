@@ -0,0 +1,595 @@
+// Package cgroupstat reports memory, CPU and I/O accounting for a cgroup,
+// the way peakben's process package reports it for a pid tree. It exists
+// because a process running inside Docker/Kubernetes/a systemd slice is
+// bound by cgroup limits that /proc/{pid}/status never reflects: VmPeak is
+// the parent's own virtual size, not the peak RSS of the cgroup it was
+// throttled against.
+package cgroupstat
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// Version identifies which cgroup hierarchy a Reporter is reading from.
+type Version int
+
+const (
+	// V1 is the legacy per-controller hierarchy (memory, cpuacct, blkio
+	// mounted as separate subtrees).
+	V1 Version = iota
+	// V2 is the unified hierarchy, identified by the presence of a
+	// cgroup.controllers file at its root.
+	V2
+)
+
+// Config describes how to locate the cgroup a Reporter should watch.
+// Exactly one of CgroupPath, ContainerID or Pid should be set.
+type Config struct {
+	// CgroupPath is a path relative to /sys/fs/cgroup, e.g.
+	// "/system.slice/docker-<id>.scope".
+	CgroupPath string
+
+	// ContainerID, together with CgroupRoot and CgroupParent, is joined
+	// into a path the way most container runtimes lay out their cgroups:
+	// {CgroupRoot}/{CgroupParent}/{ContainerID}.
+	ContainerID  string
+	CgroupRoot   string
+	CgroupParent string
+
+	// Pid resolves the cgroup by reading /proc/{pid}/cgroup at Reporter
+	// construction time, for callers that only have a pid (e.g. a
+	// process.Process) and don't know its cgroup path up front.
+	Pid func() int
+
+	// PollPeriod is how often Watch polls the cgroup files. Defaults to
+	// one second.
+	PollPeriod time.Duration
+
+	// MemThresholds maps a MemoryStats field name ("rss", "cache",
+	// "swap", "peak") to a list of byte thresholds. The first time a
+	// poll observes the field at or above a threshold, Watch logs it
+	// once; it is not repeated on subsequent polls.
+	MemThresholds map[string][]int64
+}
+
+// MemoryStats mirrors the fields peakben already tracks per-process, read
+// from the cgroup's memory controller instead of /proc/{pid}/status.
+type MemoryStats struct {
+	RSS        int64
+	Cache      int64
+	Swap       int64
+	PgMajFault int64
+	Peak       int64
+}
+
+// CPUStats is cumulative CPU time consumed by every task in the cgroup.
+type CPUStats struct {
+	UserTicks   int64
+	SystemTicks int64
+}
+
+// IOStats is cumulative block I/O across every device the cgroup has
+// touched.
+type IOStats struct {
+	ReadBytes  int64
+	WriteBytes int64
+}
+
+// Snapshot is one poll's worth of accounting for a cgroup.
+type Snapshot struct {
+	Memory MemoryStats
+	CPU    CPUStats
+	IO     IOStats
+}
+
+// Reporter polls a single cgroup's memory.current/memory.stat, cpu.stat
+// and io.stat (or their v1 equivalents) on an interval and emits
+// Snapshots, optionally logging the first time a memory field crosses a
+// caller-supplied threshold.
+type Reporter struct {
+	path    string
+	version Version
+	period  time.Duration
+
+	memThresholds map[string][]int64
+
+	mu      sync.Mutex
+	crossed map[string]map[int64]bool
+}
+
+// NewReporter resolves the cgroup identified by cfg and detects whether it
+// lives under the v1 or v2 hierarchy.
+func NewReporter(cfg Config) (*Reporter, error) {
+	path, err := resolveCgroupPath(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve cgroup path: %w", err)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("cgroup %s does not exist: %w", path, err)
+	}
+
+	period := cfg.PollPeriod
+	if period <= 0 {
+		period = time.Second
+	}
+
+	return &Reporter{
+		path:          path,
+		version:       detectVersion(path),
+		period:        period,
+		memThresholds: cfg.MemThresholds,
+		crossed:       map[string]map[int64]bool{},
+	}, nil
+}
+
+func resolveCgroupPath(cfg Config) (string, error) {
+	switch {
+	case cfg.CgroupPath != "":
+		return filepath.Join(cgroupRoot, cfg.CgroupPath), nil
+	case cfg.ContainerID != "":
+		root := cfg.CgroupRoot
+		if root == "" {
+			root = cgroupRoot
+		}
+		return resolveContainerPath(root, cfg.CgroupParent, cfg.ContainerID)
+	case cfg.Pid != nil:
+		return cgroupPathFromPid(cfg.Pid())
+	default:
+		return "", fmt.Errorf("no cgroup identified: one of CgroupPath, ContainerID or Pid is required")
+	}
+}
+
+// cgroupPathFromPid reads /proc/{pid}/cgroup and returns the absolute
+// /sys/fs/cgroup path for that pid. On v2 there is a single "0::/path"
+// line; on v1 there is one line per controller, mounted at
+// /sys/fs/cgroup/{controller}/{relPath}, and the memory controller's line
+// is preferred.
+func cgroupPathFromPid(pid int) (string, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", fmt.Errorf("failed to open /proc/%d/cgroup: %w", pid, err)
+	}
+	defer f.Close()
+
+	controller, relPath, err := parseCgroupFile(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to scan /proc/%d/cgroup: %w", pid, err)
+	}
+	if relPath == "" {
+		return "", fmt.Errorf("pid %d is not in any cgroup", pid)
+	}
+	if controller == "" {
+		// cgroup v2: single unified hierarchy, no controller segment.
+		return filepath.Join(cgroupRoot, relPath), nil
+	}
+
+	return filepath.Join(cgroupRoot, controller, relPath), nil
+}
+
+// parseCgroupFile picks the line to use out of the contents of a
+// /proc/{pid}/cgroup file: on v2 there is a single "0::/path" line, which is
+// returned with an empty controller; on v1 there is one line per
+// controller and the memory controller's line is preferred, with the
+// first controller seen kept as a fallback if memory isn't present.
+func parseCgroupFile(r io.Reader) (controller, relPath string, err error) {
+	var fallbackController, fallbackPath string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		controllers, path := parts[1], parts[2]
+		if controllers == "" {
+			return "", path, nil
+		}
+		for _, c := range strings.Split(controllers, ",") {
+			if fallbackPath == "" {
+				fallbackController, fallbackPath = c, path
+			}
+			if c == "memory" {
+				return c, path, nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+
+	return fallbackController, fallbackPath, nil
+}
+
+// resolveContainerPath joins root/parent/containerID the way most container
+// runtimes lay out their cgroups, trying the v2 unified hierarchy first and
+// falling back to the v1 memory controller's subtree, since v1 mounts each
+// controller under its own directory (e.g. root/memory/...) rather than
+// directly under root.
+func resolveContainerPath(root, parent, containerID string) (string, error) {
+	v2Path := filepath.Join(root, parent, containerID)
+	if _, err := os.Stat(v2Path); err == nil {
+		return v2Path, nil
+	}
+
+	v1Path := filepath.Join(root, "memory", parent, containerID)
+	if _, err := os.Stat(v1Path); err == nil {
+		return v1Path, nil
+	}
+
+	// Neither exists yet (or we can't see it); return the v2 path and let
+	// the caller's os.Stat in NewReporter report the real error.
+	return v2Path, nil
+}
+
+// detectVersion reports v2 (unified hierarchy) if cgroup.controllers
+// exists at path, and v1 otherwise.
+func detectVersion(path string) Version {
+	if _, err := os.Stat(filepath.Join(path, "cgroup.controllers")); err == nil {
+		return V2
+	}
+	return V1
+}
+
+// Poll reads a single Snapshot of the cgroup's current accounting.
+func (r *Reporter) Poll() (Snapshot, error) {
+	mem, err := r.readMemoryStats()
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read memory stats: %w", err)
+	}
+
+	cpu, err := r.readCPUStats()
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read cpu stats: %w", err)
+	}
+
+	io, err := r.readIOStats()
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read io stats: %w", err)
+	}
+
+	return Snapshot{Memory: mem, CPU: cpu, IO: io}, nil
+}
+
+// Watch polls the cgroup every PollPeriod until stop is closed, sending a
+// Snapshot on the returned channel after each poll and logging the first
+// time a configured memory threshold is crossed. A poll that errors (e.g.
+// the cgroup was removed) is skipped rather than closing the channel, so a
+// short-lived container doesn't need special-casing by the caller.
+func (r *Reporter) Watch(stop <-chan struct{}) <-chan Snapshot {
+	ch := make(chan Snapshot)
+
+	go func() {
+		defer close(ch)
+
+		tick := time.NewTicker(r.period)
+		defer tick.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-tick.C:
+				snap, err := r.Poll()
+				if err != nil {
+					continue
+				}
+				r.checkThresholds(snap)
+				select {
+				case ch <- snap:
+				case <-stop:
+					return
+				}
+			}
+		}
+	}()
+
+	return ch
+}
+
+func (r *Reporter) checkThresholds(snap Snapshot) {
+	for metric, thresholds := range r.memThresholds {
+		value, ok := memoryField(snap.Memory, metric)
+		if !ok {
+			continue
+		}
+		for _, threshold := range thresholds {
+			if value < threshold {
+				continue
+			}
+			if r.markCrossed(metric, threshold) {
+				log.Printf("cgroupstat: %s crossed %d bytes (now %d) for cgroup %s", metric, threshold, value, r.path)
+			}
+		}
+	}
+}
+
+func memoryField(m MemoryStats, name string) (int64, bool) {
+	switch name {
+	case "rss":
+		return m.RSS, true
+	case "cache":
+		return m.Cache, true
+	case "swap":
+		return m.Swap, true
+	case "peak":
+		return m.Peak, true
+	default:
+		return 0, false
+	}
+}
+
+// missingOK reports whether err is just "file does not exist" - e.g. a
+// controller that wasn't delegated to this cgroup, or swap accounting
+// compiled out - as opposed to a real failure. Poll treats a missing
+// optional file as all-zeros instead of failing the whole snapshot,
+// since Watch skips a Snapshot entirely on any Poll error and would
+// otherwise emit nothing forever after a single absent file.
+func missingOK(err error) bool {
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// markCrossed records metric/threshold as crossed and reports whether this
+// is the first time it has been observed.
+func (r *Reporter) markCrossed(metric string, threshold int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.crossed[metric] == nil {
+		r.crossed[metric] = map[int64]bool{}
+	}
+	if r.crossed[metric][threshold] {
+		return false
+	}
+	r.crossed[metric][threshold] = true
+
+	return true
+}
+
+func (r *Reporter) readMemoryStats() (MemoryStats, error) {
+	if r.version == V2 {
+		return r.readMemoryStatsV2()
+	}
+	return r.readMemoryStatsV1()
+}
+
+func (r *Reporter) readMemoryStatsV2() (MemoryStats, error) {
+	current, err := readInt64File(filepath.Join(r.path, "memory.current"))
+	if err != nil {
+		return MemoryStats{}, err
+	}
+	swap, err := readInt64File(filepath.Join(r.path, "memory.swap.current"))
+	if err != nil {
+		if !missingOK(err) {
+			return MemoryStats{}, err
+		}
+		// swap accounting is commonly compiled out or disabled via
+		// swapaccount=0; treat it as "no swap used" rather than failing.
+		swap = 0
+	}
+	// memory.peak was only added in Linux 5.19; fall back to the current
+	// value so older kernels still get a usable (if less interesting)
+	// number instead of an error.
+	peak, err := readInt64File(filepath.Join(r.path, "memory.peak"))
+	if err != nil {
+		peak = current
+	}
+
+	stat, err := readKeyedInt64File(filepath.Join(r.path, "memory.stat"))
+	if err != nil {
+		return MemoryStats{}, err
+	}
+
+	return MemoryStats{
+		RSS:        stat["anon"],
+		Cache:      stat["file"],
+		Swap:       swap,
+		PgMajFault: stat["pgmajfault"],
+		Peak:       peak,
+	}, nil
+}
+
+func (r *Reporter) readMemoryStatsV1() (MemoryStats, error) {
+	usage, err := readInt64File(filepath.Join(r.path, "memory.usage_in_bytes"))
+	if err != nil {
+		return MemoryStats{}, err
+	}
+	swap, err := readInt64File(filepath.Join(r.path, "memory.memsw.usage_in_bytes"))
+	if err != nil {
+		// swap accounting can be compiled out; treat as "no swap used"
+		// rather than failing the whole read.
+		swap = usage
+	}
+	peak, err := readInt64File(filepath.Join(r.path, "memory.max_usage_in_bytes"))
+	if err != nil {
+		peak = usage
+	}
+
+	stat, err := readKeyedInt64File(filepath.Join(r.path, "memory.stat"))
+	if err != nil {
+		return MemoryStats{}, err
+	}
+
+	return MemoryStats{
+		RSS:        stat["rss"],
+		Cache:      stat["cache"],
+		Swap:       swap - usage,
+		PgMajFault: stat["pgmajfault"],
+		Peak:       peak,
+	}, nil
+}
+
+func (r *Reporter) readCPUStats() (CPUStats, error) {
+	if r.version == V2 {
+		stat, err := readKeyedInt64File(filepath.Join(r.path, "cpu.stat"))
+		if err != nil {
+			if missingOK(err) {
+				// the cpu controller wasn't delegated to this cgroup.
+				return CPUStats{}, nil
+			}
+			return CPUStats{}, err
+		}
+		// cpu.stat reports microseconds; convert to USER_HZ jiffies, the
+		// unit v1's cpuacct.stat reports in.
+		return CPUStats{
+			UserTicks:   usecToTicks(stat["user_usec"]),
+			SystemTicks: usecToTicks(stat["system_usec"]),
+		}, nil
+	}
+
+	stat, err := readKeyedInt64File(filepath.Join(r.path, "cpuacct.stat"))
+	if err != nil {
+		if missingOK(err) {
+			return CPUStats{}, nil
+		}
+		return CPUStats{}, err
+	}
+
+	return CPUStats{
+		UserTicks:   stat["user"],
+		SystemTicks: stat["system"],
+	}, nil
+}
+
+func usecToTicks(usec int64) int64 {
+	const clockTicks = 100
+	return usec * clockTicks / 1_000_000
+}
+
+func (r *Reporter) readIOStats() (IOStats, error) {
+	var io IOStats
+	var err error
+	if r.version == V2 {
+		io, err = readIOStatsV2(filepath.Join(r.path, "io.stat"))
+	} else {
+		io, err = readIOStatsV1(filepath.Join(r.path, "blkio.throttle.io_service_bytes"))
+	}
+	if err != nil && missingOK(err) {
+		// the io controller wasn't delegated to this cgroup.
+		return IOStats{}, nil
+	}
+	return io, err
+}
+
+// readIOStatsV2 parses io.stat, one line per device:
+// "8:0 rbytes=1234 wbytes=5678 rios=1 wios=1 dbytes=0 dios=0".
+func readIOStatsV2(path string) (IOStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return IOStats{}, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var io IOStats
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		for _, field := range strings.Fields(scanner.Text())[1:] {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				continue
+			}
+			v, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			switch key {
+			case "rbytes":
+				io.ReadBytes += v
+			case "wbytes":
+				io.WriteBytes += v
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return IOStats{}, fmt.Errorf("failed to scan %s: %w", path, err)
+	}
+
+	return io, nil
+}
+
+// readIOStatsV1 parses blkio.throttle.io_service_bytes, one line per
+// device+op: "8:0 Read 1234".
+func readIOStatsV1(path string) (IOStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return IOStats{}, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var io IOStats
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		v, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[1] {
+		case "Read":
+			io.ReadBytes += v
+		case "Write":
+			io.WriteBytes += v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return IOStats{}, fmt.Errorf("failed to scan %s: %w", path, err)
+	}
+
+	return io, nil
+}
+
+func readInt64File(path string) (int64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return v, nil
+}
+
+// readKeyedInt64File parses files shaped like "key value\nkey value\n...",
+// the format memory.stat, cpuacct.stat and cpu.stat all share.
+func readKeyedInt64File(path string) (map[string]int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	values := map[string]int64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[fields[0]] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", path, err)
+	}
+
+	return values, nil
+}
@@ -0,0 +1,151 @@
+package cgroupstat
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCgroupFile(t *testing.T) {
+	cases := []struct {
+		name           string
+		cgroupFile     string
+		wantController string
+		wantPath       string
+		wantErr        bool
+	}{
+		{
+			name:           "v2 unified hierarchy",
+			cgroupFile:     "0::/system.slice/docker-abc123.scope\n",
+			wantController: "",
+			wantPath:       "/system.slice/docker-abc123.scope",
+		},
+		{
+			name: "v1 prefers the memory controller",
+			cgroupFile: "11:memory:/docker/abc123\n" +
+				"10:cpuacct,cpu:/docker/abc123\n" +
+				"4:blkio:/docker/abc123\n",
+			wantController: "memory",
+			wantPath:       "/docker/abc123",
+		},
+		{
+			name: "v1 falls back to the first controller if memory is absent",
+			cgroupFile: "10:cpuacct,cpu:/docker/abc123\n" +
+				"4:blkio:/docker/abc123\n",
+			wantController: "cpuacct",
+			wantPath:       "/docker/abc123",
+		},
+		{
+			name:       "no cgroup lines",
+			cgroupFile: "",
+			wantPath:   "",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			controller, relPath, err := parseCgroupFile(strings.NewReader(tc.cgroupFile))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if controller != tc.wantController {
+				t.Errorf("controller: got %q, want %q", controller, tc.wantController)
+			}
+			if relPath != tc.wantPath {
+				t.Errorf("relPath: got %q, want %q", relPath, tc.wantPath)
+			}
+		})
+	}
+}
+
+func TestDetectVersion(t *testing.T) {
+	v2Dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(v2Dir, "cgroup.controllers"), []byte("memory cpu io\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := detectVersion(v2Dir); got != V2 {
+		t.Errorf("got %v, want V2", got)
+	}
+
+	v1Dir := t.TempDir()
+	if got := detectVersion(v1Dir); got != V1 {
+		t.Errorf("got %v, want V1", got)
+	}
+}
+
+func TestResolveContainerPath(t *testing.T) {
+	t.Run("v2 path used when it exists", func(t *testing.T) {
+		root := t.TempDir()
+		v2Dir := filepath.Join(root, "docker", "abc123")
+		if err := os.MkdirAll(v2Dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := resolveContainerPath(root, "docker", "abc123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v2Dir {
+			t.Errorf("got %s, want %s", got, v2Dir)
+		}
+	})
+
+	t.Run("falls back to the v1 memory subtree", func(t *testing.T) {
+		root := t.TempDir()
+		v1Dir := filepath.Join(root, "memory", "docker", "abc123")
+		if err := os.MkdirAll(v1Dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := resolveContainerPath(root, "docker", "abc123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v1Dir {
+			t.Errorf("got %s, want %s", got, v1Dir)
+		}
+	})
+
+	t.Run("neither hierarchy exists yet, defaults to the v2 path", func(t *testing.T) {
+		root := t.TempDir()
+		got, err := resolveContainerPath(root, "docker", "abc123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := filepath.Join(root, "docker", "abc123")
+		if got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	})
+}
+
+func TestReadKeyedInt64File(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "memory.stat")
+	contents := "anon 1048576\ninactive_file 2048\npgmajfault 3\n"
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readKeyedInt64File(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int64{"anon": 1048576, "inactive_file": 2048, "pgmajfault": 3}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("key %s: got %d, want %d", k, got[k], v)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Collector receives each ProcessStats sample Watch takes. Implementations
+// are called sequentially from the goroutine Watch drives them from, so a
+// Collector does not need its own locking unless it is also read from
+// elsewhere (RingCollector locks, since its samples are read by a
+// different goroutine than the one that collects them; PrometheusCollector
+// relies on the prometheus gauges being safe for concurrent use).
+type Collector interface {
+	Collect(ctx context.Context, stats ProcessStats) error
+}
+
+// errChBuffer bounds how many undrained errors Watch will hold for a
+// caller that reads stats but not errors, so a run of sampling or
+// collector errors doesn't stall the watch loop. Once full, sendError
+// drops the oldest queued error to make room rather than blocking.
+const errChBuffer = 16
+
+// Watch samples GetStats every interval and fans each sample out to every
+// collector, in order. Unlike WatchStats, which panics on a zero interval,
+// Watch never panics or log.Fatals: a non-positive interval (which ends the
+// watch), sampling errors and collector errors are all sent on the
+// returned error channel instead, so a single bad sample or a collector
+// that's temporarily unreachable (e.g. a Prometheus push gateway) doesn't
+// take down the whole watch loop. The error channel is buffered
+// (errChBuffer) and non-blocking: a caller that never reads it will not
+// stall sample delivery on ch, but will silently miss errors once the
+// buffer fills. Callers that care about errors should drain errCh
+// alongside ch. Stop watching by cancelling ctx; both channels are closed
+// once the watch goroutine has exited.
+func (p *Process) Watch(ctx context.Context, interval time.Duration, collectors ...Collector) (<-chan ProcessStats, <-chan error) {
+	ch := make(chan ProcessStats)
+	errCh := make(chan error, errChBuffer)
+
+	go func() {
+		defer close(ch)
+		defer close(errCh)
+
+		if interval <= 0 {
+			sendError(ctx, errCh, fmt.Errorf("refresh interval must be positive, got %v", interval))
+			return
+		}
+
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+				stats, err := p.GetStats()
+				if err != nil {
+					if !sendError(ctx, errCh, fmt.Errorf("failed getting stats: %w", err)) {
+						return
+					}
+					continue
+				}
+
+				for _, c := range collectors {
+					if err := c.Collect(ctx, stats); err != nil {
+						if !sendError(ctx, errCh, fmt.Errorf("collector failed: %w", err)) {
+							return
+						}
+					}
+				}
+
+				select {
+				case ch <- stats:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, errCh
+}
+
+// sendError delivers err on errCh, reporting false if ctx was cancelled
+// first so the caller knows to stop rather than block forever on a
+// channel nobody is reading anymore. If errCh's buffer is full - a caller
+// that isn't draining it - the oldest queued error is dropped to make
+// room instead of blocking the watch loop on a channel nobody reads.
+func sendError(ctx context.Context, errCh chan error, err error) bool {
+	for {
+		select {
+		case errCh <- err:
+			return true
+		case <-ctx.Done():
+			return false
+		default:
+		}
+
+		select {
+		case <-errCh:
+		default:
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// JSONLinesCollector writes one JSON object per sample to w, newline
+// delimited, in the shape of ProcessStats (its cpu_usage and memory_usage
+// objects) so downstream tools can tail or pipe the output. It does not
+// write the MemoryInfoEx breakdown or per-mapping MemoryMaps data.
+type JSONLinesCollector struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONLinesCollector(w io.Writer) *JSONLinesCollector {
+	return &JSONLinesCollector{enc: json.NewEncoder(w)}
+}
+
+func (j *JSONLinesCollector) Collect(_ context.Context, stats ProcessStats) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.enc.Encode(stats); err != nil {
+		return fmt.Errorf("failed to write json line: %w", err)
+	}
+
+	return nil
+}
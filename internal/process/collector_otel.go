@@ -0,0 +1,72 @@
+package process
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// OTelCollector reports Process samples through an OpenTelemetry Meter, on
+// whatever exporter the caller's MeterProvider is wired to: resident and
+// virtual memory in bytes, and the sample's CPU percentage. Unlike
+// PrometheusCollector it has no peak or per-child gauges, and it reports
+// CPU as a percentage rather than cumulative seconds.
+type OTelCollector struct {
+	proc *Process
+
+	rss   metric.Int64Gauge
+	vms   metric.Int64Gauge
+	cpu   metric.Float64Gauge
+	attrs metric.MeasurementOption
+}
+
+func NewOTelCollector(meter metric.Meter, p *Process) (*OTelCollector, error) {
+	rss, err := meter.Int64Gauge(
+		"process.memory.rss",
+		metric.WithUnit("By"),
+		metric.WithDescription("Resident memory size."),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rss gauge: %w", err)
+	}
+
+	vms, err := meter.Int64Gauge(
+		"process.memory.virtual",
+		metric.WithUnit("By"),
+		metric.WithDescription("Virtual memory size."),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vms gauge: %w", err)
+	}
+
+	cpu, err := meter.Float64Gauge(
+		"process.cpu.utilization",
+		metric.WithDescription("CPU percentage consumed since the last sample."),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cpu gauge: %w", err)
+	}
+
+	return &OTelCollector{
+		proc:  p,
+		rss:   rss,
+		vms:   vms,
+		cpu:   cpu,
+		attrs: metric.WithAttributes(attribute.Int("pid", int(p.Pid))),
+	}, nil
+}
+
+func (o *OTelCollector) Collect(ctx context.Context, stats ProcessStats) error {
+	mem, err := o.proc.MemoryInfoEx()
+	if err != nil {
+		return fmt.Errorf("failed to read memory info: %w", err)
+	}
+
+	o.rss.Record(ctx, stats.MemoryUsage.Rss*1024, o.attrs)
+	o.vms.Record(ctx, mem.VMS, o.attrs)
+	o.cpu.Record(ctx, float64(stats.CpuUsage.Percentage), o.attrs)
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusCollector turns Process samples into the gauges top-level
+// monitoring expects: process_resident_memory_bytes,
+// process_virtual_memory_bytes, process_cpu_seconds_total and
+// process_peak_memory_bytes, plus a per-child RSS gauge. It implements our
+// own Collector interface rather than prometheus.Collector directly (the
+// two can't share a type - both define a differently-shaped Collect
+// method) - register the gauges it owns with a registry via MustRegister
+// once, then call Collect from Watch on every tick to keep them current.
+type PrometheusCollector struct {
+	proc *Process
+
+	rss         prometheus.Gauge
+	vms         prometheus.Gauge
+	cpuSeconds  prometheus.Gauge
+	peakRss     prometheus.Gauge
+	childRss    *prometheus.GaugeVec
+	peakRssSeen int64
+}
+
+func NewPrometheusCollector(p *Process) *PrometheusCollector {
+	labels := prometheus.Labels{"pid": strconv.Itoa(int(p.Pid))}
+
+	return &PrometheusCollector{
+		proc: p,
+		rss: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "process_resident_memory_bytes",
+			Help:        "Resident memory size in bytes.",
+			ConstLabels: labels,
+		}),
+		vms: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "process_virtual_memory_bytes",
+			Help:        "Virtual memory size in bytes.",
+			ConstLabels: labels,
+		}),
+		cpuSeconds: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "process_cpu_seconds_total",
+			Help:        "Total user and system CPU time spent in seconds.",
+			ConstLabels: labels,
+		}),
+		peakRss: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "process_peak_memory_bytes",
+			Help:        "Peak resident memory size observed in bytes.",
+			ConstLabels: labels,
+		}),
+		childRss: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "process_child_resident_memory_bytes",
+			Help:        "Resident memory size in bytes, per child pid.",
+			ConstLabels: labels,
+		}, []string{"child_pid"}),
+	}
+}
+
+// MustRegister registers every gauge this collector owns with reg.
+func (pc *PrometheusCollector) MustRegister(reg *prometheus.Registry) {
+	reg.MustRegister(pc.rss, pc.vms, pc.cpuSeconds, pc.peakRss, pc.childRss)
+}
+
+func (pc *PrometheusCollector) Collect(_ context.Context, stats ProcessStats) error {
+	mem, err := pc.proc.MemoryInfoEx()
+	if err != nil {
+		return fmt.Errorf("failed to read memory info: %w", err)
+	}
+
+	rssBytes := stats.MemoryUsage.Rss * 1024
+	if rssBytes > pc.peakRssSeen {
+		pc.peakRssSeen = rssBytes
+		pc.peakRss.Set(float64(rssBytes))
+	}
+
+	pc.rss.Set(float64(rssBytes))
+	pc.vms.Set(float64(mem.VMS))
+	pc.cpuSeconds.Set(stats.CpuUsage.UserTime + stats.CpuUsage.SystemTime)
+
+	children, err := pc.proc.GetChildrenPids()
+	if err != nil {
+		return fmt.Errorf("failed to list children: %w", err)
+	}
+	for _, child := range children {
+		childRss, err := readSmapsField(child, "Rss")
+		if err != nil {
+			continue
+		}
+		pc.childRss.WithLabelValues(strconv.Itoa(int(child))).Set(float64(childRss * 1024))
+	}
+
+	return nil
+}
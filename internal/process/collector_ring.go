@@ -0,0 +1,73 @@
+package process
+
+import (
+	"context"
+	"sync"
+)
+
+// RingCollector keeps the last N ProcessStats samples in memory along with
+// the running peak RSS and CPU percentage observed, for callers that just
+// want "what happened recently" without standing up a real metrics
+// backend.
+type RingCollector struct {
+	mu      sync.Mutex
+	samples []ProcessStats
+	size    int
+	count   int
+	head    int
+	peak    ProcessStats
+}
+
+// NewRingCollector creates a RingCollector holding up to size samples. A
+// non-positive size is treated as 1.
+func NewRingCollector(size int) *RingCollector {
+	if size <= 0 {
+		size = 1
+	}
+	return &RingCollector{
+		samples: make([]ProcessStats, size),
+		size:    size,
+	}
+}
+
+func (r *RingCollector) Collect(_ context.Context, stats ProcessStats) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.samples[r.head] = stats
+	r.head = (r.head + 1) % r.size
+	if r.count < r.size {
+		r.count++
+	}
+
+	if stats.MemoryUsage.Rss > r.peak.MemoryUsage.Rss {
+		r.peak.MemoryUsage = stats.MemoryUsage
+	}
+	if stats.CpuUsage.Percentage > r.peak.CpuUsage.Percentage {
+		r.peak.CpuUsage = stats.CpuUsage
+	}
+
+	return nil
+}
+
+// Samples returns up to the last N collected samples, oldest first.
+func (r *RingCollector) Samples() []ProcessStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]ProcessStats, r.count)
+	for i := 0; i < r.count; i++ {
+		idx := (r.head - r.count + i + r.size) % r.size
+		out[i] = r.samples[idx]
+	}
+
+	return out
+}
+
+// Peak returns the highest RSS and the highest CPU percentage seen so far.
+// The two fields are not necessarily from the same sample.
+func (r *RingCollector) Peak() ProcessStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.peak
+}
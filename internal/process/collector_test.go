@@ -0,0 +1,41 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSendErrorDropsOldestWhenFull(t *testing.T) {
+	ctx := context.Background()
+	errCh := make(chan error, 2)
+
+	first := errors.New("first")
+	second := errors.New("second")
+	third := errors.New("third")
+
+	for _, err := range []error{first, second, third} {
+		if !sendError(ctx, errCh, err) {
+			t.Fatalf("sendError(%v) reported ctx cancelled", err)
+		}
+	}
+
+	// The buffer only holds 2; "first" should have been dropped to make
+	// room for "third" rather than sendError blocking forever.
+	got := []error{<-errCh, <-errCh}
+	if got[0] != second || got[1] != third {
+		t.Fatalf("got %v, want [second third]", got)
+	}
+}
+
+func TestSendErrorReturnsFalseOnCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// An unbuffered channel with nobody reading would block forever on a
+	// plain send; sendError must notice ctx is already done instead.
+	errCh := make(chan error)
+	if sendError(ctx, errCh, errors.New("boom")) {
+		t.Fatal("expected sendError to report false for a cancelled context")
+	}
+}
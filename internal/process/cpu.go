@@ -0,0 +1,191 @@
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is the kernel's USER_HZ, i.e. the unit utime/stime/starttime
+// in /proc/{pid}/stat are expressed in. It is 100 on every architecture
+// Linux still supports sysconf(_SC_CLK_TCK) for.
+const clockTicks = 100
+
+// procStat is the subset of /proc/{pid}/stat fields needed for CPU
+// accounting, all in clock ticks.
+type procStat struct {
+	utime, stime, cutime, cstime, starttime, iowait int64
+}
+
+// readProcStat parses /proc/{pid}/stat.
+func readProcStat(pid int32) (*procStat, error) {
+	b, err := ioutil.ReadFile(statDir(pid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stat file for pid %d: %w", pid, err)
+	}
+
+	stat, err := parseProcStat(b)
+	if err != nil {
+		return nil, fmt.Errorf("%w for pid %d", err, pid)
+	}
+
+	return stat, nil
+}
+
+// parseProcStat parses the contents of a /proc/{pid}/stat file. The command
+// name in field 2 is parenthesised and may itself contain spaces or
+// parens, so fields are counted from the last ')' on the line rather than
+// by naive splitting.
+func parseProcStat(b []byte) (*procStat, error) {
+	rparen := strings.LastIndex(string(b), ")")
+	if rparen == -1 {
+		return nil, fmt.Errorf("malformed stat file")
+	}
+
+	fields := strings.Fields(string(b)[rparen+1:])
+	// fields[0] is state (field 3); utime/stime/cutime/cstime/starttime/
+	// delayacct_blkio_ticks are fields 14/15/16/17/22/42, i.e. indexes
+	// 11/12/13/14/19/39 here.
+	if len(fields) < 40 {
+		return nil, fmt.Errorf("malformed stat file")
+	}
+
+	parse := func(i int) (int64, error) {
+		return strconv.ParseInt(fields[i], 10, 64)
+	}
+
+	utime, err := parse(11)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse utime: %w", err)
+	}
+	stime, err := parse(12)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse stime: %w", err)
+	}
+	cutime, err := parse(13)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cutime: %w", err)
+	}
+	cstime, err := parse(14)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cstime: %w", err)
+	}
+	starttime, err := parse(19)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse starttime: %w", err)
+	}
+	iowait, err := parse(39)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse delayacct_blkio_ticks: %w", err)
+	}
+
+	return &procStat{
+		utime:     utime,
+		stime:     stime,
+		cutime:    cutime,
+		cstime:    cstime,
+		starttime: starttime,
+		iowait:    iowait,
+	}, nil
+}
+
+// totalSystemTicks sums the per-mode jiffy counters on the aggregate "cpu"
+// line of /proc/stat, giving the total CPU time the whole system has
+// consumed since boot, across all cores.
+func totalSystemTicks() (int64, error) {
+	b, err := ioutil.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read /proc/stat: %w", err)
+	}
+
+	line, _, _ := strings.Cut(string(b), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "cpu" {
+		return 0, fmt.Errorf("malformed /proc/stat")
+	}
+
+	var total int64
+	for _, f := range fields[1:] {
+		v, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			continue
+		}
+		total += v
+	}
+
+	return total, nil
+}
+
+// cpuSample is the previous (process ticks, total system ticks) pair a
+// Process remembers between GetCpuUsage calls, so that Percentage reflects
+// CPU consumed since the last sample rather than a lifetime average.
+type cpuSample struct {
+	stat  *procStat
+	total int64
+}
+
+type CpuUsage struct {
+	Percentage     float32 `json:"percentage"`       // percent of a single core consumed since the last sample
+	PercentPerCore float32 `json:"percent_per_core"` // Percentage normalized across NumCPU cores
+	NumCPU         int     `json:"num_cpu"`
+	UserTime       float64 `json:"user_time"`   // cumulative seconds in user mode
+	SystemTime     float64 `json:"system_time"` // cumulative seconds in kernel mode
+}
+
+// GetCpuUsage returns the process's CPU usage since the previous call, the
+// way gopsutil and top compute it: by diffing utime+stime against the
+// previous sample and normalizing by the system-wide tick delta over the
+// same interval, rather than forking `ps` and `awk` for a lifetime average.
+// The first call on a Process has no prior sample to diff against, so it
+// returns a zero Percentage.
+func (p *Process) GetCpuUsage() (CpuUsage, error) {
+	stat, err := readProcStat(p.Pid)
+	if err != nil {
+		return CpuUsage{}, fmt.Errorf("failed to read proc stat: %w", err)
+	}
+
+	total, err := totalSystemTicks()
+	if err != nil {
+		return CpuUsage{}, fmt.Errorf("failed to read total system ticks: %w", err)
+	}
+
+	numCPU := runtime.NumCPU()
+	usage := CpuUsage{
+		NumCPU:     numCPU,
+		UserTime:   float64(stat.utime) / clockTicks,
+		SystemTime: float64(stat.stime) / clockTicks,
+	}
+
+	p.cpuMu.Lock()
+	prev := p.prevCpuSample
+	p.prevCpuSample = &cpuSample{stat: stat, total: total}
+	p.cpuMu.Unlock()
+
+	if prev != nil && total > prev.total {
+		procDelta := float64((stat.utime + stat.stime) - (prev.stat.utime + prev.stat.stime))
+		totalDelta := float64(total - prev.total)
+		usage.Percentage = float32(100 * (procDelta / totalDelta) * float64(numCPU))
+		usage.PercentPerCore = usage.Percentage / float32(numCPU)
+	}
+
+	return usage, nil
+}
+
+// Times returns the process's cumulative CPU time in seconds, broken down
+// into user mode, kernel mode, time spent waiting on block I/O, and time
+// already-exited children spent in user+kernel mode (reaped via wait()).
+func (p *Process) Times() (user, system, iowait, children float64, err error) {
+	stat, err := readProcStat(p.Pid)
+	if err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("failed to read proc stat: %w", err)
+	}
+
+	user = float64(stat.utime) / clockTicks
+	system = float64(stat.stime) / clockTicks
+	iowait = float64(stat.iowait) / clockTicks
+	children = float64(stat.cutime+stat.cstime) / clockTicks
+
+	return user, system, iowait, children, nil
+}
@@ -0,0 +1,80 @@
+package process
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// makeStatLine builds a synthetic /proc/{pid}/stat line with comm as the
+// parenthesised field 2 and the given utime/stime/cutime/cstime/starttime/
+// iowait values at their real field offsets (14/15/16/17/22/42), padding
+// every other field with "0".
+func makeStatLine(comm string, utime, stime, cutime, cstime, starttime, iowait int64) string {
+	fields := make([]string, 40) // indices 0..39, i.e. stat fields 3..42
+	for i := range fields {
+		fields[i] = "0"
+	}
+	fields[0] = "S" // field 3: state
+	fields[11] = fmt.Sprintf("%d", utime)
+	fields[12] = fmt.Sprintf("%d", stime)
+	fields[13] = fmt.Sprintf("%d", cutime)
+	fields[14] = fmt.Sprintf("%d", cstime)
+	fields[19] = fmt.Sprintf("%d", starttime)
+	fields[39] = fmt.Sprintf("%d", iowait)
+
+	return fmt.Sprintf("1234 (%s) %s", comm, strings.Join(fields, " "))
+}
+
+func TestParseProcStat(t *testing.T) {
+	cases := []struct {
+		name    string
+		stat    string
+		want    *procStat
+		wantErr bool
+	}{
+		{
+			// comm is parenthesised and may itself contain spaces and
+			// parens, which is why parsing hunts for the last ')' rather
+			// than splitting naively.
+			name: "well-formed with parenthesised comm",
+			stat: makeStatLine("my (weird) process", 11, 12, 13, 14, 19, 39),
+			want: &procStat{
+				utime:     11,
+				stime:     12,
+				cutime:    13,
+				cstime:    14,
+				starttime: 19,
+				iowait:    39,
+			},
+		},
+		{
+			name:    "too few fields",
+			stat:    "1234 (sh) S 1 1234",
+			wantErr: true,
+		},
+		{
+			name:    "missing comm close-paren",
+			stat:    "1234 (sh S 1 1234",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseProcStat([]byte(tc.stat))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *got != *tc.want {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
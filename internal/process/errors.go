@@ -0,0 +1,16 @@
+package process
+
+import "errors"
+
+var (
+	// ErrProcessNotFound is returned when the pid passed to NewProcess does
+	// not exist, and by GetStatus (wrapped by GetName) when
+	// /proc/{pid}/status is gone. Other reads return the underlying
+	// os error wrapped instead.
+	ErrProcessNotFound = errors.New("process not found")
+
+	// ErrPermission is returned by GetStatus (wrapped by GetName) when the
+	// kernel denies the read of /proc/{pid}/status, typically because the
+	// target process is owned by another user.
+	ErrPermission = errors.New("permission denied")
+)
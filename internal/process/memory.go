@@ -0,0 +1,334 @@
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type MemoryUsage struct {
+	Rss     int64 `json:"rss"`
+	RssSwap int64 `json:"rss_swap"`
+}
+
+// MemoryInfoEx is a finer breakdown of a process's own memory map than the
+// plain RSS figure in MemoryUsage, taken from /proc/{pid}/statm. All fields
+// are in bytes.
+type MemoryInfoEx struct {
+	RSS    int64 // resident set size
+	VMS    int64 // virtual memory size
+	Shared int64 // pages backed by a file
+	Text   int64 // text (code)
+	Lib    int64 // library, unused on Linux >= 2.6
+	Data   int64 // data + stack
+	Dirty  int64 // dirty pages, unused on Linux >= 2.6
+}
+
+// MemoryMapsStat is the parsed representation of one mapping block in
+// /proc/{pid}/smaps. All fields are in kilobytes, matching the unit the
+// kernel reports them in.
+type MemoryMapsStat struct {
+	Path         string
+	Rss          int64
+	Pss          int64
+	SharedClean  int64
+	SharedDirty  int64
+	PrivateClean int64
+	PrivateDirty int64
+	Referenced   int64
+	Anonymous    int64
+	Swap         int64
+}
+
+// GetMemoryUsage returns the current Rss and RssSwap in a single descendant
+// walk: Rss and Swap are read from the same smaps pass instead of walking
+// the process tree once per field.
+func (p *Process) GetMemoryUsage() (MemoryUsage, error) {
+	emptymu := MemoryUsage{}
+
+	totals, err := p.aggregateSmapsFields("Rss", "Swap")
+	if err != nil {
+		return emptymu, fmt.Errorf("failed getting process memory usage: %w", err)
+	}
+
+	return MemoryUsage{
+		Rss:     totals["Rss"],
+		RssSwap: totals["Rss"] + totals["Swap"],
+	}, nil
+}
+
+// GetChildrenPids returns the pids of the direct children of the process.
+func (p *Process) GetChildrenPids() ([]int32, error) {
+	return childrenPids(p.Pid)
+}
+
+// GetRss returns the current memory usage in kilobytes of the process.
+// This is calculated from the total RSS, read from smaps, of the process
+// and every descendant in its process tree. RSS includes heap and stack
+// memory, but not swap memory.
+func (p *Process) GetRss() (int64, error) {
+	return p.aggregateSmapsField("Rss")
+}
+
+// GetRssWithSwap returns the current memory usage in kilobytes of the
+// process, including swap, across the process and every descendant in its
+// process tree.
+func (p *Process) GetRssWithSwap() (int64, error) {
+	totals, err := p.aggregateSmapsFields("Rss", "Swap")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rss with swap: %w", err)
+	}
+
+	return totals["Rss"] + totals["Swap"], nil
+}
+
+// aggregateSmapsField sums field (e.g. "Rss", "Swap", "Pss") across p and
+// every descendant in its process tree, reading smaps directly instead of
+// piping through grep/awk.
+func (p *Process) aggregateSmapsField(field string) (int64, error) {
+	var total int64
+	for _, pid := range descendantPids(p.Pid) {
+		v, err := readSmapsField(pid, field)
+		if err != nil {
+			// the pid may have exited between enumeration and read
+			continue
+		}
+		total += v
+	}
+
+	return total, nil
+}
+
+// readSmapsField returns the total kilobytes the kernel reports for field
+// across every mapping of pid. It prefers smaps_rollup, which the kernel
+// aggregates for us, and falls back to summing smaps directly on kernels
+// that don't have it.
+func readSmapsField(pid int32, field string) (int64, error) {
+	totals, err := readSmapsFields(pid, []string{field})
+	if err != nil {
+		return 0, err
+	}
+	return totals[field], nil
+}
+
+// aggregateSmapsFields sums each of fields (e.g. "Rss", "Swap") across p and
+// every descendant in its process tree, reading every field off a single
+// smaps scan per pid rather than one scan per field.
+func (p *Process) aggregateSmapsFields(fields ...string) (map[string]int64, error) {
+	totals := make(map[string]int64, len(fields))
+	for _, pid := range descendantPids(p.Pid) {
+		v, err := readSmapsFields(pid, fields)
+		if err != nil {
+			// the pid may have exited between enumeration and read
+			continue
+		}
+		for _, field := range fields {
+			totals[field] += v[field]
+		}
+	}
+
+	return totals, nil
+}
+
+// readSmapsFields returns the total kilobytes the kernel reports for each of
+// fields across every mapping of pid, in one pass over smaps. It prefers
+// smaps_rollup, which the kernel aggregates for us, and falls back to
+// summing smaps directly on kernels that don't have it.
+func readSmapsFields(pid int32, fields []string) (map[string]int64, error) {
+	f, err := os.Open(smapsRollupDir(pid))
+	if err != nil {
+		f, err = os.Open(smapsDir(pid))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open smaps for pid %d: %w", pid, err)
+		}
+	}
+	defer f.Close()
+
+	totals, err := parseSmapsFields(f, fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan smaps for pid %d: %w", pid, err)
+	}
+
+	return totals, nil
+}
+
+// parseSmapsFields sums each of fields (e.g. "Rss", "Swap", matched as the
+// "Rss:" and "Swap:" line prefixes) over every matching line in r, which may be a whole smaps file (one block of fields
+// per mapping) or a smaps_rollup file (a single already-aggregated block) -
+// summing works the same way either way.
+func parseSmapsFields(r io.Reader, fields []string) (map[string]int64, error) {
+	prefixes := make(map[string]string, len(fields))
+	totals := make(map[string]int64, len(fields))
+	for _, field := range fields {
+		prefixes[field] = field + ":"
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for field, prefix := range prefixes {
+			if !strings.HasPrefix(line, prefix) {
+				continue
+			}
+			parts := strings.Fields(line)
+			if len(parts) < 2 {
+				break
+			}
+			v, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				break
+			}
+			totals[field] += v
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return totals, nil
+}
+
+// MemoryInfoEx returns a breakdown of the process's own memory usage, not
+// including any descendants.
+func (p *Process) MemoryInfoEx() (*MemoryInfoEx, error) {
+	return readStatm(p.Pid)
+}
+
+func readStatm(pid int32) (*MemoryInfoEx, error) {
+	b, err := ioutil.ReadFile(statmDir(pid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read statm for pid %d: %w", pid, err)
+	}
+
+	mem, err := parseStatm(b)
+	if err != nil {
+		return nil, fmt.Errorf("%w for pid %d", err, pid)
+	}
+
+	return mem, nil
+}
+
+// parseStatm parses the space-separated page counts in a statm file's
+// contents - size resident shared text lib data dirty, in that order - and
+// converts them to bytes.
+func parseStatm(b []byte) (*MemoryInfoEx, error) {
+	fields := strings.Fields(string(b))
+	if len(fields) < 7 {
+		return nil, fmt.Errorf("malformed statm file")
+	}
+
+	pageSize := int64(os.Getpagesize())
+	vals := make([]int64, 7)
+	for i, f := range fields[:7] {
+		v, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse statm field %d: %w", i, err)
+		}
+		vals[i] = v * pageSize
+	}
+
+	return &MemoryInfoEx{
+		VMS:    vals[0],
+		RSS:    vals[1],
+		Shared: vals[2],
+		Text:   vals[3],
+		Lib:    vals[4],
+		Data:   vals[5],
+		Dirty:  vals[6],
+	}, nil
+}
+
+// MemoryMaps parses /proc/{pid}/smaps and returns one MemoryMapsStat per
+// mapping, in address order.
+func (p *Process) MemoryMaps() ([]MemoryMapsStat, error) {
+	f, err := os.Open(smapsDir(p.Pid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open smaps for pid %d: %w", p.Pid, err)
+	}
+	defer f.Close()
+
+	var maps []MemoryMapsStat
+	var cur *MemoryMapsStat
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if isSmapsHeaderLine(line) {
+			if cur != nil {
+				maps = append(maps, *cur)
+			}
+			cur = &MemoryMapsStat{Path: smapsHeaderPath(line)}
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		applySmapsField(cur, line)
+	}
+	if cur != nil {
+		maps = append(maps, *cur)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan smaps for pid %d: %w", p.Pid, err)
+	}
+
+	return maps, nil
+}
+
+// isSmapsHeaderLine reports whether line is a mapping header ("addr perms
+// offset dev inode [pathname]") rather than one of the "Key: value kB"
+// fields that follow it. Field lines always have a colon-terminated key as
+// their first token; header lines never do.
+func isSmapsHeaderLine(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+	return !strings.HasSuffix(fields[0], ":")
+}
+
+func smapsHeaderPath(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) < 6 {
+		return ""
+	}
+	return fields[5]
+}
+
+func applySmapsField(m *MemoryMapsStat, line string) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return
+	}
+
+	v, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return
+	}
+
+	switch strings.TrimSuffix(fields[0], ":") {
+	case "Rss":
+		m.Rss = v
+	case "Pss":
+		m.Pss = v
+	case "Shared_Clean":
+		m.SharedClean = v
+	case "Shared_Dirty":
+		m.SharedDirty = v
+	case "Private_Clean":
+		m.PrivateClean = v
+	case "Private_Dirty":
+		m.PrivateDirty = v
+	case "Referenced":
+		m.Referenced = v
+	case "Anonymous":
+		m.Anonymous = v
+	case "Swap":
+		m.Swap = v
+	}
+}
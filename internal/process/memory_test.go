@@ -0,0 +1,124 @@
+package process
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSmapsFields(t *testing.T) {
+	cases := []struct {
+		name   string
+		smaps  string
+		fields []string
+		want   map[string]int64
+	}{
+		{
+			name: "single mapping, single field",
+			smaps: "Rss:                 120 kB\n" +
+				"Pss:                  60 kB\n",
+			fields: []string{"Rss"},
+			want:   map[string]int64{"Rss": 120},
+		},
+		{
+			name: "sums across multiple mappings",
+			smaps: "7f0000000000-7f0000021000 rw-p 00000000 00:00 0\n" +
+				"Rss:                 100 kB\n" +
+				"Swap:                  0 kB\n" +
+				"7f0000021000-7f0000042000 rw-p 00000000 00:00 0\n" +
+				"Rss:                  50 kB\n" +
+				"Swap:                 10 kB\n",
+			fields: []string{"Rss", "Swap"},
+			want:   map[string]int64{"Rss": 150, "Swap": 10},
+		},
+		{
+			name:   "rollup file, both fields requested but only one present",
+			smaps:  "Rss:                 200 kB\n",
+			fields: []string{"Rss", "Swap"},
+			want:   map[string]int64{"Rss": 200},
+		},
+		{
+			name:   "no matching lines",
+			smaps:  "VmFlags: rd wr mr mw me\n",
+			fields: []string{"Rss"},
+			want:   map[string]int64{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseSmapsFields(strings.NewReader(tc.smaps), tc.fields)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+			for field, want := range tc.want {
+				if got[field] != want {
+					t.Errorf("field %s: got %d, want %d", field, got[field], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseStatm(t *testing.T) {
+	pageSize := int64(pageSizeForTest())
+
+	cases := []struct {
+		name    string
+		statm   string
+		want    *MemoryInfoEx
+		wantErr bool
+	}{
+		{
+			name:  "well-formed",
+			statm: "1000 500 100 50 0 200 0\n",
+			want: &MemoryInfoEx{
+				VMS:    1000 * pageSize,
+				RSS:    500 * pageSize,
+				Shared: 100 * pageSize,
+				Text:   50 * pageSize,
+				Lib:    0,
+				Data:   200 * pageSize,
+				Dirty:  0,
+			},
+		},
+		{
+			name:    "too few fields",
+			statm:   "1000 500\n",
+			wantErr: true,
+		},
+		{
+			name:    "non-numeric field",
+			statm:   "1000 five 100 50 0 200 0\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseStatm([]byte(tc.statm))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *got != *tc.want {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func pageSizeForTest() int {
+	mem, err := parseStatm([]byte("1 0 0 0 0 0 0\n"))
+	if err != nil {
+		panic(err)
+	}
+	return int(mem.VMS)
+}
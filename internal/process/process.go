@@ -1,84 +1,116 @@
 package process
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
 type Process struct {
-	Pid        int32
-	statusFile *os.File
-}
+	Pid int32
 
-const (
-	LinuxProcStatusPath = "/proc/{pid}/status"
-	LinuxProcSmapsPath  = "/proc/{pid}/smaps"
-)
+	cpuMu         sync.Mutex
+	prevCpuSample *cpuSample
+
+	peak peakTracker
+}
 
+// NewProcess validates that pid exists and returns a Process handle for
+// it. It no longer opens or holds a long-lived file descriptor on
+// /proc/{pid}/status: /proc files are cheap to open, and holding one
+// across an execve() in the target gives stale data anyway, so every read
+// method below opens what it needs fresh.
 func NewProcess(pid int32) (*Process, error) {
-	statusFile, err := loadStatusFile(pid)
-	if err != nil {
+	if err := checkPidExists(pid); err != nil {
 		return nil, err
 	}
 
-	return &Process{pid, statusFile}, nil
+	return &Process{Pid: pid}, nil
 }
 
-func statusDir(pid int32) string {
-	path := strings.Replace(LinuxProcStatusPath, "{pid}", fmt.Sprintf("%d", pid), 1)
-	return path
-}
+// NewProcessWithContext is NewProcess for callers that want the pid
+// validation to respect ctx cancellation.
+func NewProcessWithContext(ctx context.Context, pid int32) (*Process, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
 
-func smapsDir(pid int32) string {
-	path := strings.Replace(LinuxProcSmapsPath, "{pid}", fmt.Sprintf("%d", pid), 1)
-	return path
+	return NewProcess(pid)
 }
 
-func loadStatusFile(pid int32) (*os.File, error) {
-	var statusFile *os.File
-	for {
-		s, err := os.Open(statusDir(pid))
-		statusFile = s
+// Processes enumerates every pid currently visible under /proc and returns
+// a Process for each one that still exists by the time it's opened. Pids
+// that exit mid-enumeration are skipped rather than failing the whole
+// call, since /proc is inherently a snapshot of a moving target - this is
+// the native equivalent of attaching to whatever `pgrep` would have
+// matched.
+func Processes() ([]*Process, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /proc: %w", err)
+	}
+
+	var procs []*Process
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		p, err := NewProcess(int32(pid))
 		if err != nil {
 			continue
 		}
-		break
+		procs = append(procs, p)
 	}
 
-	return statusFile, nil
+	return procs, nil
 }
 
-func readStatusMap(statusFile *os.File) (map[string]string, error) {
-	b, err := ioutil.ReadAll(statusFile)
+// signalZero sends signal 0 to pid, which performs all of the kernel's
+// existence/permission checks without actually signaling anything.
+func signalZero(pid int32) error {
+	if pid <= 0 {
+		return fmt.Errorf("invalid pid %v", pid)
+	}
+	proc, err := os.FindProcess(int(pid))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read status file: %w", err)
+		return err
 	}
+	return proc.Signal(syscall.Signal(0))
+}
 
-	statusMap := map[string]string{}
-
-	values := strings.Split(string(b), "\n")
-
-	for _, v := range values {
-		keyValue := strings.Split(v, ":\t")
-		key := keyValue[0]
-		if key == "" {
-			break
-		}
-		value := keyValue[1]
-		statusMap[key] = value
+// checkPidExists returns ErrProcessNotFound if pid does not exist, nil if
+// it does (even if we don't have permission to signal it - EPERM still
+// means the kernel found the process), and the raw error for anything
+// else.
+func checkPidExists(pid int32) error {
+	err := signalZero(pid)
+	if err == nil {
+		return nil
 	}
-
-	statusFile.Seek(0, io.SeekStart)
-
-	return statusMap, nil
+	if err.Error() == "os: process already finished" {
+		return ErrProcessNotFound
+	}
+	errno, ok := err.(syscall.Errno)
+	if !ok {
+		return err
+	}
+	switch errno {
+	case syscall.ESRCH:
+		return ErrProcessNotFound
+	case syscall.EPERM:
+		return nil
+	}
+	return err
 }
 
 type ProcessState string
@@ -91,22 +123,13 @@ const (
 )
 
 type ProcessStatus struct {
-	Name         string
-	VmPeakMemory int64
-	VmSize       int64
+	Name   string
+	VmSize int64
 }
 
 // IsRunning sends signal 0, which is a signal for nothing but still performs error checking
 func (p *Process) IsRunning() (bool, error) {
-	pid := p.Pid
-	if pid <= 0 {
-		return false, fmt.Errorf("invalid pid %v", pid)
-	}
-	proc, err := os.FindProcess(int(pid))
-	if err != nil {
-		return false, err
-	}
-	err = proc.Signal(syscall.Signal(0))
+	err := signalZero(p.Pid)
 	if err == nil {
 		return true, nil
 	}
@@ -127,16 +150,18 @@ func (p *Process) IsRunning() (bool, error) {
 }
 
 func getStatus(pid int32) (*ProcessStatus, error) {
-	sf, err := os.Open(statusDir(pid))
+	b, err := ioutil.ReadFile(statusDir(pid))
 	if err != nil {
+		if os.IsPermission(err) {
+			return nil, ErrPermission
+		}
+		if os.IsNotExist(err) {
+			return nil, ErrProcessNotFound
+		}
 		return nil, fmt.Errorf("failed to open status file: %w", err)
 	}
-	defer sf.Close()
-	smap, err := readStatusMap(sf)
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to load process status: %w", err)
-	}
+	smap := parseStatusMap(b)
 
 	vmSizeStr := strings.Split(strings.Trim(smap["VmSize"], "\n \t"), " ")[0]
 	vmSize, err := strconv.ParseInt(vmSizeStr, 10, 64)
@@ -152,79 +177,69 @@ func getStatus(pid int32) (*ProcessStatus, error) {
 	return pc, nil
 }
 
-func (p *Process) GetStatus() (*ProcessStatus, error) {
-	var smap map[string]string
-	var err error
-	for {
-		smap, err = readStatusMap(p.statusFile)
-		if err == nil {
+func parseStatusMap(b []byte) map[string]string {
+	statusMap := map[string]string{}
+
+	values := strings.Split(string(b), "\n")
+
+	for _, v := range values {
+		keyValue := strings.Split(v, ":\t")
+		key := keyValue[0]
+		if key == "" {
 			break
 		}
+		value := keyValue[1]
+		statusMap[key] = value
 	}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to load process status: %w", err)
-	}
-
-	pc := &ProcessStatus{
-		Name: smap["Name"],
-	}
+	return statusMap
+}
 
-	return pc, nil
+func (p *Process) GetStatus() (*ProcessStatus, error) {
+	return getStatus(p.Pid)
 }
 
+// GetState reads the process state out of field 3 of /proc/{pid}/stat
+// (one of R/S/D/Z/...), the same field `ps -o state` reports, without
+// forking a shell to get it.
 func (p *Process) GetState() ProcessState {
-	cmd := fmt.Sprintf("ps -q %d -o state --no-headers", p.Pid)
-	e, err := exec.Command("bash", "-c", cmd).Output()
+	state, err := readState(p.Pid)
 	if err != nil {
-		panic("error getting process status")
+		return ""
 	}
-	eStr := strings.Trim(string(e), " \n")
-	return ProcessState(eStr)
+	return state
 }
 
-// GetPeakMemory returns the peak memory usage the process has reached.
+// GetPeakMemory returns the peak RSS, in kilobytes, that StartPeakSampler
+// has observed across p and its descendants so far, matching the unit
+// GetRss and MemoryUsage.Rss report. It is 0 until a sampler has completed
+// at least one pass; VmPeak in /proc/{pid}/status is not a substitute,
+// since it only tracks the single process's own virtual size, not the RSS
+// peak across the whole tree a sampler folds in.
 func (p *Process) GetPeakMemory() (int64, error) {
-	s, err := p.GetStatus()
-	if err != nil {
-		return 0, fmt.Errorf("failed to get process status: %w", err)
-	}
-	return s.VmPeakMemory, err
-}
-
-type MemoryUsage struct {
-	Rss     int64
-	RssSwap int64
-}
-
-type CpuUsage struct {
-	Percentage float32
+	return p.Peak().PeakRSS, nil
 }
 
 type ProcessStats struct {
-	CpuUsage    CpuUsage
-	MemoryUsage MemoryUsage
+	CpuUsage    CpuUsage    `json:"cpu_usage"`
+	MemoryUsage MemoryUsage `json:"memory_usage"`
 }
 
+// WatchStats is the original, single-channel predecessor of Watch, kept
+// for existing callers. It no longer log.Fatalfs on a sample error -
+// which used to take down the whole process just because one /proc read
+// failed - and instead logs and carries on, the way Watch's error channel
+// lets a caller do explicitly. New code should prefer Watch.
 func (p *Process) WatchStats(interval time.Duration) <-chan ProcessStats {
-	ch := make(chan ProcessStats)
-
-	go func() {
-		if interval == 0 {
-			panic("refresh interval must be non-zero")
-		}
-		defer close(ch)
-
-		tick := time.NewTicker(interval)
-		defer tick.Stop()
+	if interval == 0 {
+		panic("refresh interval must be non-zero")
+	}
 
-		for range tick.C {
-			stats, err := p.GetStats()
-			if err != nil {
-				log.Fatalf("error getting stats: %v", err)
-			}
+	ch, errCh := p.Watch(context.Background(), interval)
 
-			ch <- stats
+	go func() {
+		for err := range errCh {
+			log.Printf("error getting stats: %v", err)
 		}
 	}()
 
@@ -250,142 +265,6 @@ func (p *Process) GetStats() (ProcessStats, error) {
 	}, nil
 }
 
-func (p *Process) GetCpuUsage() (CpuUsage, error) {
-	emptycpu := CpuUsage{}
-
-	cmd := fmt.Sprintf(`ps -p %d -o %%cpu | awk 'FNR == 2 {gsub(/ /,""); print}'`, p.Pid)
-	out, err := exec.Command("bash", "-c", cmd).Output()
-	if err != nil {
-		return emptycpu, fmt.Errorf("failed to run command: %v", err)
-	}
-
-	if len(out) == 0 {
-		return emptycpu, fmt.Errorf("output from cpu usage command is empty")
-	}
-
-	outStr := strings.Trim(string(out), " \n")
-
-	cpuPercent64, err := strconv.ParseFloat(outStr, 32)
-	if err != nil {
-		return emptycpu, fmt.Errorf("failed to parse output to float: %w", err)
-	}
-	cpuPercent := float32(cpuPercent64)
-
-	return CpuUsage{
-		Percentage: cpuPercent,
-	}, nil
-}
-
-func (p *Process) GetMemoryUsage() (MemoryUsage, error) {
-	emptymu := MemoryUsage{}
-
-	rss, err := p.GetRss()
-	if err != nil {
-		return emptymu, fmt.Errorf("failed getting process rss: %w", err)
-	}
-	rssSwap, err := p.GetRssWithSwap()
-	if err != nil {
-		return emptymu, fmt.Errorf("failed getting process rss with swap: %w", err)
-	}
-
-	return MemoryUsage{
-		Rss:     rss,
-		RssSwap: rssSwap,
-	}, nil
-}
-
-func (p *Process) GetChildrenPids() ([]int32, error) {
-	cmd := strings.Fields(fmt.Sprintf("pgrep -P %d", p.Pid))
-	pidsBytes, err := exec.Command(cmd[0], cmd[1:]...).Output()
-	if err != nil {
-		return nil, nil
-	}
-	pidsBytes = []byte(strings.Trim(string(pidsBytes), "\n "))
-	pidsStrArr := strings.Split(string(pidsBytes), "\n")
-	var pids []int32
-	for _, pid := range pidsStrArr {
-		pid = strings.Trim(pid, "\n ")
-		p, err := strconv.Atoi(pid)
-		if err != nil {
-			return nil, fmt.Errorf("failec converting %q to int: %s", pid, err)
-		}
-		pids = append(pids, int32(p))
-	}
-	return pids, nil
-}
-
-// GetRss returns the current memory usage in kilobytes of the process.
-// This is calculated from the total RSS from all the libraries and itself
-// that the process uses. RSS includes heap and stack memory, but not swap memory.
-func (p *Process) GetRss() (int64, error) {
-	children, err := p.GetChildrenPids()
-	children = append(children, p.Pid)
-	if err != nil {
-		return 0, err
-	}
-	var total int64 = 0
-	for _, child := range children {
-		cmd := fmt.Sprintf(`cat %s | grep -i rss |  awk '{Total+=$2} END {print Total}'`, smapsDir(child))
-		rss, err := exec.Command("bash", "-c", cmd).Output()
-		if err != nil {
-			if err.Error() != "signal: interrupt" {
-				return 0, fmt.Errorf("failed executing command %s: %s", cmd, err)
-			}
-		}
-		rss = []byte(strings.Trim(string(rss), "\n "))
-		if len(rss) == 0 {
-			continue
-		}
-
-		memUsage, err := strconv.Atoi(string(rss))
-		if err != nil {
-			return 0, fmt.Errorf("failed to convert output %q to int: %w", rss, err)
-		}
-		total = total + int64(memUsage)
-	}
-
-	return total, err
-}
-
-// GetRssWithSwap returns the current memory usage in kilobytes of the process.
-// This is calculated from the total memory from all the libraries and itself
-// that the process uses.
-func (p *Process) GetRssWithSwap() (int64, error) {
-	children, err := p.GetChildrenPids()
-	children = append(children, p.Pid)
-	if err != nil {
-		return 0, err
-	}
-	var total int64 = 0
-	for _, child := range children {
-		cmd := fmt.Sprintf(`cat %s | grep -i swap |  awk '{Total+=$2} END {print Total}'`, smapsDir(child))
-		rss, err := exec.Command("bash", "-c", cmd).Output()
-		if err != nil {
-			if err.Error() != "signal: interrupt" {
-				return 0, fmt.Errorf("failed executing command %s: %s", cmd, err)
-			}
-		}
-
-		rss = []byte(strings.Trim(string(rss), "\n "))
-		if len(rss) == 0 {
-			continue
-		}
-
-		swapUsage, err := strconv.Atoi(string(rss))
-		if err != nil {
-			return 0, fmt.Errorf("failed to convert size to int: %w", err)
-		}
-
-		memUsage, err := p.GetRss()
-		if err != nil {
-			return 0, fmt.Errorf("failed to get memory and swap usage: %w", err)
-		}
-		total = total + memUsage + int64(swapUsage)
-	}
-
-	return total, err
-}
-
 func (p *Process) GetName() (string, error) {
 	status, err := p.GetStatus()
 	if err != nil {
@@ -0,0 +1,121 @@
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	LinuxProcStatusPath      = "/proc/{pid}/status"
+	LinuxProcStatPath        = "/proc/{pid}/stat"
+	LinuxProcStatmPath       = "/proc/{pid}/statm"
+	LinuxProcSmapsPath       = "/proc/{pid}/smaps"
+	LinuxProcSmapsRollupPath = "/proc/{pid}/smaps_rollup"
+	LinuxProcTaskPath        = "/proc/{pid}/task"
+)
+
+func procPath(template string, pid int32) string {
+	return strings.Replace(template, "{pid}", strconv.Itoa(int(pid)), 1)
+}
+
+func statusDir(pid int32) string {
+	return procPath(LinuxProcStatusPath, pid)
+}
+
+func statDir(pid int32) string {
+	return procPath(LinuxProcStatPath, pid)
+}
+
+func statmDir(pid int32) string {
+	return procPath(LinuxProcStatmPath, pid)
+}
+
+func smapsDir(pid int32) string {
+	return procPath(LinuxProcSmapsPath, pid)
+}
+
+func smapsRollupDir(pid int32) string {
+	return procPath(LinuxProcSmapsRollupPath, pid)
+}
+
+func taskDir(pid int32) string {
+	return procPath(LinuxProcTaskPath, pid)
+}
+
+// readState reads the process state (one of R/S/D/Z/T/...) out of field 3
+// of /proc/{pid}/stat. The command name in field 2 is parenthesised and may
+// itself contain spaces or parens, so the state is found by looking past
+// the last ')' on the line rather than by splitting on whitespace.
+func readState(pid int32) (ProcessState, error) {
+	b, err := ioutil.ReadFile(statDir(pid))
+	if err != nil {
+		return "", fmt.Errorf("failed to read stat file: %w", err)
+	}
+
+	line := string(b)
+	rparen := strings.LastIndex(line, ")")
+	if rparen == -1 || rparen+1 >= len(line) {
+		return "", fmt.Errorf("malformed stat file for pid %d", pid)
+	}
+
+	fields := strings.Fields(line[rparen+1:])
+	if len(fields) == 0 {
+		return "", fmt.Errorf("malformed stat file for pid %d", pid)
+	}
+
+	return ProcessState(fields[0]), nil
+}
+
+// childrenPids returns the direct children of pid by reading the children
+// file of every thread under /proc/{pid}/task, the interface the kernel has
+// exposed since CONFIG_PROC_CHILDREN landed, instead of shelling out to
+// pgrep.
+func childrenPids(pid int32) ([]int32, error) {
+	threads, err := ioutil.ReadDir(taskDir(pid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read task dir for pid %d: %w", pid, err)
+	}
+
+	var pids []int32
+	for _, thread := range threads {
+		b, err := ioutil.ReadFile(filepath.Join(taskDir(pid), thread.Name(), "children"))
+		if err != nil {
+			continue
+		}
+		for _, f := range strings.Fields(string(b)) {
+			cpid, err := strconv.Atoi(f)
+			if err != nil {
+				continue
+			}
+			pids = append(pids, int32(cpid))
+		}
+	}
+
+	return pids, nil
+}
+
+// descendantPids walks the process tree rooted at pid (pid included),
+// following childrenPids recursively, and returns every pid reachable from
+// it. A pid that exits mid-walk is simply skipped rather than failing the
+// whole traversal.
+func descendantPids(pid int32) []int32 {
+	pids := []int32{pid}
+	queue := []int32{pid}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		children, err := childrenPids(cur)
+		if err != nil {
+			continue
+		}
+		pids = append(pids, children...)
+		queue = append(queue, children...)
+	}
+
+	return pids
+}